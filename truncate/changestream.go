@@ -0,0 +1,237 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"os"
+	"time"
+)
+
+// dataChangeRecord is a single row change observed on a change stream, trimmed
+// down to the fields truncate needs in order to issue a targeted delete.
+type dataChangeRecord struct {
+	TableName       string
+	ModType         string // INSERT, UPDATE, or DELETE
+	Keys            []spanner.Key
+	CommitTimestamp time.Time
+}
+
+// changeRecordColumn mirrors the STRUCT returned by the ChangeRecord column
+// of a change stream's READ_<stream_name> table-valued function: an array
+// of DataChangeRecord (the only record kind truncate cares about), plus the
+// heartbeat/child-partition record kinds it ignores.
+// https://cloud.google.com/spanner/docs/change-streams/details#data-change-records
+type changeRecordColumn struct {
+	DataChangeRecord []rawDataChangeRecord `spanner:"data_change_record"`
+}
+
+// rawDataChangeRecord is the subset of a DataChangeRecord's fields truncate
+// needs: which table and mod type the change belongs to, and the primary
+// key values of the affected row, JSON-encoded as a map of column name to value.
+type rawDataChangeRecord struct {
+	CommitTimestamp time.Time `spanner:"commit_timestamp"`
+	TableName       string    `spanner:"table_name"`
+	Mods            []rawMod  `spanner:"mods"`
+	ModType         string    `spanner:"mod_type"`
+}
+
+// rawMod is one row's worth of changed key/value data within a DataChangeRecord.
+type rawMod struct {
+	Keys spanner.NullJSON `spanner:"keys"`
+}
+
+// changeStreamCheckpoint records the commit timestamp of the last record
+// successfully processed for a given change stream, so that a re-run can
+// resume from there instead of reprocessing records from sinceTimestamp.
+type changeStreamCheckpoint struct {
+	StreamName     string    `json:"streamName"`
+	LastRecordTime time.Time `json:"lastRecordTime"`
+}
+
+// checkpointStore persists and loads changeStreamCheckpoint values. The file
+// based implementation below is sufficient for single-host use; it is an
+// interface so tests (and future backends such as a Spanner table) can stub
+// it out.
+type checkpointStore interface {
+	load(streamName string) (*changeStreamCheckpoint, error)
+	save(cp *changeStreamCheckpoint) error
+}
+
+// fileCheckpointStore persists checkpoints as JSON files on the local
+// filesystem, one file per change stream.
+type fileCheckpointStore struct {
+	dir string
+}
+
+func newFileCheckpointStore(dir string) *fileCheckpointStore {
+	return &fileCheckpointStore{dir: dir}
+}
+
+func (s *fileCheckpointStore) path(streamName string) string {
+	return fmt.Sprintf("%s/%s.checkpoint.json", s.dir, streamName)
+}
+
+func (s *fileCheckpointStore) load(streamName string) (*changeStreamCheckpoint, error) {
+	b, err := os.ReadFile(s.path(streamName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint for %s: %v", streamName, err)
+	}
+	var cp changeStreamCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint for %s: %v", streamName, err)
+	}
+	return &cp, nil
+}
+
+func (s *fileCheckpointStore) save(cp *changeStreamCheckpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint for %s: %v", cp.StreamName, err)
+	}
+	if err := os.WriteFile(s.path(cp.StreamName), b, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint for %s: %v", cp.StreamName, err)
+	}
+	return nil
+}
+
+// changeStreamReader reads DataChangeRecords from a Cloud Spanner change
+// stream via the partitioned query API, buffering them and returning the
+// collected primary keys to the caller for deletion once the read finishes.
+type changeStreamReader struct {
+	client     *spanner.Client
+	streamName string
+	store      checkpointStore
+}
+
+func newChangeStreamReader(client *spanner.Client, streamName string, store checkpointStore) *changeStreamReader {
+	return &changeStreamReader{client: client, streamName: streamName, store: store}
+}
+
+// read queries the change stream for records committed at or after since,
+// resuming from the last checkpointed commit timestamp when one is
+// available, and returns, per table, the primary keys of rows that were
+// inserted or updated; DELETE records are skipped. primaryKeys
+// gives the primary key column order truncate needs to turn each mod's
+// JSON-encoded key map into a spanner.Key.
+func (r *changeStreamReader) read(ctx context.Context, since time.Time, primaryKeys map[string][]string) (map[string][]spanner.Key, error) {
+	cp, err := r.store.load(r.streamName)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil && cp.LastRecordTime.After(since) {
+		since = cp.LastRecordTime
+	}
+
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("SELECT ChangeRecord FROM READ_%s(@since, NULL)", r.streamName),
+		Params: map[string]interface{}{
+			"since": since,
+		},
+	}
+
+	keysByTable := map[string][]spanner.Key{}
+	lastTime := since
+
+	iter := r.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read change stream %s: %v", r.streamName, err)
+		}
+
+		recs, err := decodeDataChangeRecords(row, primaryKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode change record from %s: %v", r.streamName, err)
+		}
+
+		for _, rec := range recs {
+			if rec.ModType == "INSERT" || rec.ModType == "UPDATE" {
+				keysByTable[rec.TableName] = append(keysByTable[rec.TableName], rec.Keys...)
+			}
+			if rec.CommitTimestamp.After(lastTime) {
+				lastTime = rec.CommitTimestamp
+			}
+		}
+	}
+
+	if err := r.store.save(&changeStreamCheckpoint{
+		StreamName:     r.streamName,
+		LastRecordTime: lastTime,
+	}); err != nil {
+		return nil, err
+	}
+
+	return keysByTable, nil
+}
+
+// decodeDataChangeRecords unmarshals the ChangeRecord STRUCT returned by a
+// change stream's READ_<stream_name> table-valued function into zero or
+// more dataChangeRecord values, one per mod. Heartbeat and child-partition
+// records (which carry no data_change_record entries) decode to no values.
+//
+// Each mod's "keys" column is a JSON object mapping primary key column name
+// to value; primaryKeys[tableName] supplies the column order needed to turn
+// that object into a spanner.Key.
+func decodeDataChangeRecords(row *spanner.Row, primaryKeys map[string][]string) ([]*dataChangeRecord, error) {
+	var col changeRecordColumn
+	if err := row.Column(0, &col); err != nil {
+		return nil, fmt.Errorf("failed to scan ChangeRecord column: %v", err)
+	}
+
+	var recs []*dataChangeRecord
+	for _, raw := range col.DataChangeRecord {
+		pkColumns, ok := primaryKeys[raw.TableName]
+		if !ok {
+			return nil, fmt.Errorf("no primary key columns known for table %s", raw.TableName)
+		}
+
+		for _, mod := range raw.Mods {
+			if !mod.Keys.Valid {
+				continue
+			}
+			keyValues, ok := mod.Keys.Value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("unexpected mod keys shape for table %s: %T", raw.TableName, mod.Keys.Value)
+			}
+
+			keyParts := make([]interface{}, len(pkColumns))
+			for i, col := range pkColumns {
+				keyParts[i] = keyValues[col]
+			}
+
+			recs = append(recs, &dataChangeRecord{
+				TableName:       raw.TableName,
+				ModType:         raw.ModType,
+				Keys:            []spanner.Key{spanner.Key(keyParts)},
+				CommitTimestamp: raw.CommitTimestamp,
+			})
+		}
+	}
+	return recs, nil
+}
@@ -0,0 +1,50 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileCheckpointStoreRoundTrip(t *testing.T) {
+	store := newFileCheckpointStore(t.TempDir())
+
+	cp, err := store.load("MyStream")
+	if err != nil {
+		t.Fatalf("load on empty store: %v", err)
+	}
+	if cp != nil {
+		t.Fatalf("load on empty store = %+v, want nil", cp)
+	}
+
+	want := &changeStreamCheckpoint{
+		StreamName:     "MyStream",
+		LastRecordTime: time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC),
+	}
+	if err := store.save(want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := store.load("MyStream")
+	if err != nil {
+		t.Fatalf("load after save: %v", err)
+	}
+	if got == nil || !got.LastRecordTime.Equal(want.LastRecordTime) || got.StreamName != want.StreamName {
+		t.Errorf("load after save = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import "io"
+
+// options holds the settings that Run/RunWithClient accept through the
+// functional Option values below. Its zero value matches the tool's
+// historical, mutation-only behavior.
+type options struct {
+	mode       Mode
+	dryRun     bool
+	planFormat PlanFormat
+	limiter    *rateLimiter
+
+	nonInteractive bool
+	autoApprove    bool
+	progressFormat ProgressFormat
+	logger         Logger
+	stderr         io.Writer
+	checkpointDir  string
+}
+
+// Option configures optional behavior on Run/RunWithClient.
+type Option func(*options)
+
+// WithDryRun makes Run/RunWithClient compute and print the delete plan in
+// the given format instead of deleting anything; it is equivalent to
+// calling RunPlan directly. No confirmation prompt is shown.
+func WithDryRun(format PlanFormat) Option {
+	return func(o *options) {
+		o.dryRun = true
+		o.planFormat = format
+	}
+}
+
+// WithMode selects the delete backend used for tables that are eligible for
+// it (surfaced on the CLI as --mode=partitioned-dml|mutations). ModeMutations
+// (the default) is always safe; ModePartitionedDML is much faster for
+// full-table wipes but is only used for tables that are not interleaved in a
+// parent without ON DELETE CASCADE, the rest fall back to ModeMutations
+// automatically.
+func WithMode(mode Mode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// WithRateLimit bounds delete throughput to mutPerSec mutations/sec and qps
+// requests/sec, shared across the mutation-based deleters, every table
+// dispatched to the partitioned DML backend (WithMode(ModePartitionedDML)),
+// and every delete issued by RunIncremental. When Spanner returns ResourceExhausted/Aborted errors
+// repeatedly, the effective rate is halved; it doubles back up after a
+// sustained run of successes (AIMD), never leaving the [rate/8, rate] range.
+func WithRateLimit(mutPerSec, qps int) Option {
+	return func(o *options) {
+		o.limiter = newRateLimiter(mutPerSec, qps)
+	}
+}
+
+// WithCheckpointDir sets the directory RunIncremental persists its
+// change-stream checkpoints to, one JSON file per stream name. It defaults
+// to os.TempDir(), which most container/Kubernetes Job runtimes clear on
+// restart; pass a directory backed by durable storage (e.g. a mounted
+// volume) so a re-run after a failure actually resumes instead of
+// reprocessing sinceTimestamp onward.
+func WithCheckpointDir(dir string) Option {
+	return func(o *options) {
+		o.checkpointDir = dir
+	}
+}
+
+// WithNonInteractive skips the interactive confirm() prompt, making
+// RunWithClient safe to run without a TTY, e.g. in a CI job or a Kubernetes
+// Job. autoApprove must also be true for the delete to actually proceed;
+// with autoApprove false, a non-interactive run stops short of deleting
+// anything and reports what it would have deleted, as if declined.
+func WithNonInteractive(autoApprove bool) Option {
+	return func(o *options) {
+		o.nonInteractive = true
+		o.autoApprove = autoApprove
+	}
+}
+
+// WithProgressFormat selects how per-table delete progress is reported.
+func WithProgressFormat(format ProgressFormat) Option {
+	return func(o *options) {
+		o.progressFormat = format
+	}
+}
+
+// WithLogger routes RunWithClient's human-readable log messages through
+// logger instead of the standard library log package, so a caller can plug
+// in zap, logrus, or slog.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithStderr routes human log messages to stderr instead of the out writer
+// passed to RunWithClient, so that out can carry only machine-readable
+// progress events (see WithProgressFormat(ProgressFormatJSONLines)).
+func WithStderr(stderr io.Writer) Option {
+	return func(o *options) {
+		o.stderr = stderr
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{mode: ModeMutations}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
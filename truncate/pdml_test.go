@@ -0,0 +1,63 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import "testing"
+
+func TestCanUsePDML(t *testing.T) {
+	tests := []struct {
+		name            string
+		parentTable     string
+		onDeleteCascade bool
+		want            bool
+	}{
+		{name: "root table", parentTable: "", want: true},
+		{name: "interleaved without cascade", parentTable: "Parent", onDeleteCascade: false, want: false},
+		{name: "interleaved with cascade", parentTable: "Parent", onDeleteCascade: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tbl := &table{tableName: tt.name, parentTable: tt.parentTable, onDeleteCascade: tt.onDeleteCascade}
+			if got := canUsePDML(tbl); got != tt.want {
+				t.Errorf("canUsePDML(%+v) = %v, want %v", tbl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionTablesByMode(t *testing.T) {
+	root := &table{tableName: "Root"}
+	cascaded := &table{tableName: "Cascaded", parentTable: "Root", onDeleteCascade: true}
+	nonCascaded := &table{tableName: "NonCascaded", parentTable: "Root", onDeleteCascade: false}
+	tables := []*table{root, cascaded, nonCascaded}
+
+	gotPDML, gotMutation := partitionTablesByMode(tables, ModeMutations)
+	if len(gotPDML) != 0 {
+		t.Errorf("ModeMutations: got %d pdml tables, want 0", len(gotPDML))
+	}
+	if len(gotMutation) != len(tables) {
+		t.Errorf("ModeMutations: got %d mutation tables, want %d", len(gotMutation), len(tables))
+	}
+
+	gotPDML, gotMutation = partitionTablesByMode(tables, ModePartitionedDML)
+	if len(gotPDML) != 2 || gotPDML[0] != root || gotPDML[1] != cascaded {
+		t.Errorf("ModePartitionedDML: got pdml tables %+v, want [Root Cascaded]", gotPDML)
+	}
+	if len(gotMutation) != 1 || gotMutation[0] != nonCascaded {
+		t.Errorf("ModePartitionedDML: got mutation tables %+v, want [NonCascaded]", gotMutation)
+	}
+}
@@ -0,0 +1,139 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// PlanFormat selects how RunPlan renders the computed plan.
+type PlanFormat int
+
+const (
+	// PlanFormatTable renders the plan as a human-readable table.
+	PlanFormatTable PlanFormat = iota
+	// PlanFormatJSON renders the plan as a single JSON document, suitable
+	// for a CI pipeline to parse and gate a subsequent real run on.
+	PlanFormatJSON
+)
+
+// PlannedTable describes one table's place in a truncate plan.
+type PlannedTable struct {
+	TableName      string `json:"tableName"`
+	Order          int    `json:"order"`
+	RowCount       int64  `json:"rowCount"`
+	Mode           string `json:"mode"`
+	EstimatedBytes int64  `json:"estimatedBytesFreed"`
+}
+
+// Plan is the machine-readable description of what Run/RunWithClient would
+// do for a given whereClause, targetTables and excludeTables, without
+// actually deleting anything.
+type Plan struct {
+	WhereClause string         `json:"whereClause"`
+	Tables      []PlannedTable `json:"tables"`
+}
+
+// RunPlan computes the delete plan for the given parameters - schemas, row
+// counts, topologically sorted delete order, and which backend each table
+// would use - and writes it to out in the requested format. It never deletes
+// rows or prompts for confirmation.
+func RunPlan(ctx context.Context, client *spanner.Client, out io.Writer, whereClause string, targetTables, excludeTables []string, format PlanFormat, opts ...Option) error {
+	o := newOptions(opts)
+
+	schemas, err := fetchTableSchemas(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch table schema: %v", err)
+	}
+
+	schemas, err = filterTableSchemas(schemas, targetTables, excludeTables)
+	if err != nil {
+		return fmt.Errorf("failed to filter table schema: %v", err)
+	}
+
+	indexes, err := fetchIndexSchemas(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch index schema: %v", err)
+	}
+
+	coordinator, err := newCoordinator(schemas, indexes, client, whereClause)
+	if err != nil {
+		return fmt.Errorf("failed to coordinate: %v", err)
+	}
+
+	tables := flattenTables(coordinator.tables)
+	for _, table := range tables {
+		table.deleter.updateRowCount(ctx)
+	}
+
+	pdmlTables, _ := partitionTablesByMode(tables, o.mode)
+	pdmlSet := map[string]bool{}
+	for _, t := range pdmlTables {
+		pdmlSet[t.tableName] = true
+	}
+
+	plan := Plan{WhereClause: whereClause}
+	for i, table := range tables {
+		mode := "mutations"
+		if pdmlSet[table.tableName] {
+			mode = "partitioned-dml"
+		}
+		plan.Tables = append(plan.Tables, PlannedTable{
+			TableName:      table.tableName,
+			Order:          i,
+			RowCount:       table.deleter.totalRows,
+			Mode:           mode,
+			EstimatedBytes: estimateBytesFreed(table),
+		})
+	}
+
+	switch format {
+	case PlanFormatJSON:
+		return writePlanJSON(out, &plan)
+	default:
+		return writePlanTable(out, &plan)
+	}
+}
+
+// estimateBytesFreed is a rough estimate of bytes that would be freed by
+// deleting totalRows rows from table, based on its average row size.
+func estimateBytesFreed(table *table) int64 {
+	return table.deleter.totalRows * table.avgRowSizeBytes
+}
+
+func writePlanJSON(out io.Writer, plan *Plan) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(plan); err != nil {
+		return fmt.Errorf("failed to encode plan: %v", err)
+	}
+	return nil
+}
+
+func writePlanTable(out io.Writer, plan *Plan) error {
+	w := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(w, "ORDER\tTABLE\tROWS\tMODE\tEST. BYTES FREED\n")
+	for _, t := range plan.Tables {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", t.Order, t.TableName, formatNumber(t.RowCount), t.Mode, formatNumber(t.EstimatedBytes))
+	}
+	return w.Flush()
+}
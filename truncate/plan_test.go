@@ -0,0 +1,76 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testPlan() *Plan {
+	return &Plan{
+		WhereClause: "TRUE",
+		Tables: []PlannedTable{
+			{TableName: "Orders", Order: 0, RowCount: 1000, Mode: "partitioned-dml", EstimatedBytes: 50000},
+			{TableName: "OrderItems", Order: 1, RowCount: 5000, Mode: "mutations", EstimatedBytes: 250000},
+		},
+	}
+}
+
+func TestWritePlanJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePlanJSON(&buf, testPlan()); err != nil {
+		t.Fatalf("writePlanJSON: %v", err)
+	}
+
+	var got Plan
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("writePlanJSON produced invalid JSON: %v\n%s", err, buf.String())
+	}
+	if want := testPlan(); got.WhereClause != want.WhereClause || len(got.Tables) != len(want.Tables) {
+		t.Fatalf("writePlanJSON output = %+v, want %+v", got, want)
+	}
+	for i, want := range testPlan().Tables {
+		if got.Tables[i] != want {
+			t.Errorf("table %d = %+v, want %+v", i, got.Tables[i], want)
+		}
+	}
+}
+
+func TestWritePlanTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePlanTable(&buf, testPlan()); err != nil {
+		t.Fatalf("writePlanTable: %v", err)
+	}
+
+	out := buf.String()
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("writePlanTable produced %d lines, want 3 (header + 2 rows):\n%s", len(lines), out)
+	}
+	if !strings.Contains(lines[0], "TABLE") || !strings.Contains(lines[0], "MODE") {
+		t.Errorf("header line = %q, want it to mention TABLE and MODE", lines[0])
+	}
+	if !strings.Contains(lines[1], "Orders") || !strings.Contains(lines[1], "partitioned-dml") {
+		t.Errorf("row 1 = %q, want it to mention Orders and partitioned-dml", lines[1])
+	}
+	if !strings.Contains(lines[2], "OrderItems") || !strings.Contains(lines[2], "mutations") {
+		t.Errorf("row 2 = %q, want it to mention OrderItems and mutations", lines[2])
+	}
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// logf writes a human-readable log message through o.logger if one was
+// configured with WithLogger, or through the standard library log package
+// otherwise.
+func logf(o *options, format string, args ...interface{}) {
+	if o.logger != nil {
+		o.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// shouldProceed decides whether a destructive operation described by msg
+// should go ahead: it prompts interactively unless WithNonInteractive was
+// used, in which case it returns the autoApprove value passed to it.
+func shouldProceed(o *options, msg string) bool {
+	if o.nonInteractive {
+		return o.autoApprove
+	}
+	return confirm(msg)
+}
+
+// ProgressFormat selects how RunWithClient reports per-table delete progress.
+type ProgressFormat int
+
+const (
+	// ProgressFormatBars renders interactive mpb progress bars. This is the
+	// historical default and assumes out is a TTY.
+	ProgressFormatBars ProgressFormat = iota
+	// ProgressFormatJSONLines emits one JSON object per state change to out,
+	// making progress consumable by a log aggregator or a CI job.
+	ProgressFormatJSONLines
+	// ProgressFormatNone suppresses progress reporting entirely.
+	ProgressFormatNone
+)
+
+// Logger is the logging sink RunWithClient writes human-readable messages
+// to. The standard library *log.Logger satisfies this interface, and so do
+// thin adapters around zap's SugaredLogger, logrus, or slog.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// progressEvent is one line of ProgressFormatJSONLines output.
+type progressEvent struct {
+	Table   string `json:"table"`
+	Event   string `json:"event"`
+	Deleted int64  `json:"deleted"`
+	Total   int64  `json:"total"`
+	Ts      string `json:"ts"`
+}
+
+// jsonLinesReporter polls a table's deleter status and writes a progressEvent
+// to out every time the deleted row count changes, until the table completes.
+type jsonLinesReporter struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func newJSONLinesReporter(out io.Writer) *jsonLinesReporter {
+	return &jsonLinesReporter{out: out}
+}
+
+func (r *jsonLinesReporter) emit(tableName, event string, deleted, total int64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.Marshal(progressEvent{
+		Table:   tableName,
+		Event:   event,
+		Deleted: deleted,
+		Total:   total,
+		Ts:      now.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(r.out, string(b))
+}
+
+// watch polls t's deleter every second and emits a progress event to r
+// whenever the deleted row count changes, and a final "completed" event when
+// the table finishes. now is injected so this is deterministic to test.
+func (r *jsonLinesReporter) watch(t *table, now func() time.Time) {
+	var lastDeleted int64 = -1
+	for {
+		switch t.deleter.status {
+		case statusCompleted:
+			r.emit(t.tableName, "completed", t.deleter.totalRows, t.deleter.totalRows, now())
+			return
+		case statusAnalyzing:
+			// nop
+		default:
+			deleted := t.deleter.totalRows - t.deleter.remainedRows
+			if deleted != lastDeleted {
+				r.emit(t.tableName, "progress", deleted, t.deleter.totalRows, now())
+				lastDeleted = deleted
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,214 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token-bucket limiter shared across all per-table deleter
+// goroutines, bounding both mutation throughput and request QPS so that an
+// unthrottled truncate cannot saturate a Spanner instance's CPU and starve
+// production traffic.
+//
+// It also implements AIMD (additive-increase/multiplicative-decrease)
+// throttling: repeated ResourceExhausted/Aborted errors from Spanner halve
+// the effective rate, and the rate doubles back up after a sustained run of
+// successes. consecutiveErrors and consecutiveSuccesses are reset whenever the
+// rate changes.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	mutBucket *bucket
+	qpsBucket *bucket
+
+	minMutPerSec int
+	minQPS       int
+	maxMutPerSec int
+	maxQPS       int
+
+	consecutiveErrors    int
+	consecutiveSuccesses int
+}
+
+// bucket is a simple token bucket refilled at ratePerSec, capped at
+// ratePerSec. Its fields are mutated from whichever per-table goroutine last
+// calls take(), and setRate() is called by the AIMD controller from whichever
+// goroutine reports a result, so every access is guarded by mu.
+type bucket struct {
+	mu sync.Mutex
+
+	ratePerSec float64
+	tokens     float64
+	last       time.Time
+}
+
+func newBucket(ratePerSec int) *bucket {
+	return &bucket{ratePerSec: float64(ratePerSec), tokens: float64(ratePerSec)}
+}
+
+func (b *bucket) take(ctx context.Context, n int) error {
+	for {
+		wait, ok := b.tryTake(n)
+		if ok {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tryTake refills the bucket and, if n tokens are available, takes them and
+// reports ok. Otherwise it reports how long the caller should wait before
+// trying again.
+func (b *bucket) tryTake(n int) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refillLocked()
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return 0, true
+	}
+	return time.Duration(float64(time.Second) * (float64(n) - b.tokens) / b.ratePerSec), false
+}
+
+// refillLocked adds tokens for the time elapsed since the last refill. Callers
+// must hold b.mu.
+func (b *bucket) refillLocked() {
+	now := time.Now()
+	if b.last.IsZero() {
+		b.last = now
+		return
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens += elapsed * b.ratePerSec
+	if b.tokens > b.ratePerSec {
+		b.tokens = b.ratePerSec
+	}
+	b.last = now
+}
+
+func (b *bucket) setRate(ratePerSec int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ratePerSec = float64(ratePerSec)
+	if b.tokens > b.ratePerSec {
+		b.tokens = b.ratePerSec
+	}
+}
+
+// rate returns the bucket's current ratePerSec.
+func (b *bucket) rate() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.ratePerSec)
+}
+
+// newRateLimiter returns a rateLimiter allowing up to mutPerSec mutations
+// and qps requests per second. The limiter never throttles below 1/8th of
+// the configured rate, and never climbs back above it.
+func newRateLimiter(mutPerSec, qps int) *rateLimiter {
+	return &rateLimiter{
+		mutBucket:    newBucket(mutPerSec),
+		qpsBucket:    newBucket(qps),
+		minMutPerSec: max(1, mutPerSec/8),
+		minQPS:       max(1, qps/8),
+		maxMutPerSec: mutPerSec,
+		maxQPS:       qps,
+	}
+}
+
+// wait blocks until mutations tokens and one QPS token are available. It is
+// safe to call concurrently from every per-table deleter goroutine; mutBucket
+// and qpsBucket guard their own token state independently of r.mu.
+func (r *rateLimiter) wait(ctx context.Context, mutations int) error {
+	if err := r.qpsBucket.take(ctx, 1); err != nil {
+		return err
+	}
+	return r.mutBucket.take(ctx, mutations)
+}
+
+// reportResult feeds a delete outcome into the AIMD controller, halving the
+// rate after 3 consecutive throttling errors and doubling it back up after
+// 20 consecutive successes. r.mu only guards the consecutive counters here;
+// the actual rate change is applied by setRate, which locks each bucket.
+func (r *rateLimiter) reportResult(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if isThrottlingError(err) {
+		r.consecutiveSuccesses = 0
+		r.consecutiveErrors++
+		if r.consecutiveErrors >= 3 {
+			r.consecutiveErrors = 0
+			r.setRate(max(r.minMutPerSec, r.mutBucket.rate()/2), max(r.minQPS, r.qpsBucket.rate()/2))
+		}
+		return
+	}
+
+	r.consecutiveErrors = 0
+	r.consecutiveSuccesses++
+	if r.consecutiveSuccesses >= 20 {
+		r.consecutiveSuccesses = 0
+		r.setRate(min(r.maxMutPerSec, r.mutBucket.rate()*2), min(r.maxQPS, r.qpsBucket.rate()*2))
+	}
+}
+
+func (r *rateLimiter) setRate(mutPerSec, qps int) {
+	r.mutBucket.setRate(mutPerSec)
+	r.qpsBucket.setRate(qps)
+}
+
+// currentRate returns the limiter's current effective mutations/sec and QPS,
+// for reporting alongside progress decorators.
+func (r *rateLimiter) currentRate() (mutPerSec, qps int) {
+	return r.mutBucket.rate(), r.qpsBucket.rate()
+}
+
+func isThrottlingError(err error) bool {
+	if err == nil {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return errors.Is(err, context.DeadlineExceeded)
+	}
+	return s.Code() == codes.ResourceExhausted || s.Code() == codes.Aborted
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
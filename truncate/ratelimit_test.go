@@ -0,0 +1,98 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"testing"
+)
+
+func TestIsThrottlingError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, "too many requests"), want: true},
+		{name: "aborted", err: status.Error(codes.Aborted, "transaction aborted"), want: true},
+		{name: "not found", err: status.Error(codes.NotFound, "nope"), want: false},
+		{name: "non-grpc error", err: fmt.Errorf("boom"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isThrottlingError(tt.err); got != tt.want {
+				t.Errorf("isThrottlingError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAIMD(t *testing.T) {
+	r := newRateLimiter(100, 100)
+
+	for i := 0; i < 3; i++ {
+		r.reportResult(status.Error(codes.ResourceExhausted, "slow down"))
+	}
+	if mut, qps := r.currentRate(); mut != 50 || qps != 50 {
+		t.Fatalf("after 3 throttling errors: rate = (%d, %d), want (50, 50)", mut, qps)
+	}
+
+	for i := 0; i < 2; i++ {
+		r.reportResult(status.Error(codes.ResourceExhausted, "slow down"))
+	}
+	if mut, qps := r.currentRate(); mut != 50 || qps != 50 {
+		t.Fatalf("after 2 more (non-triggering) throttling errors: rate = (%d, %d), want (50, 50)", mut, qps)
+	}
+
+	for i := 0; i < 20; i++ {
+		r.reportResult(nil)
+	}
+	if mut, qps := r.currentRate(); mut != 100 || qps != 100 {
+		t.Fatalf("after 20 successes: rate = (%d, %d), want back to (100, 100)", mut, qps)
+	}
+
+	// Halving should never go below the configured floor of rate/8.
+	for i := 0; i < 30; i++ {
+		r.reportResult(status.Error(codes.ResourceExhausted, "slow down"))
+	}
+	if mut, qps := r.currentRate(); mut != 12 || qps != 12 {
+		t.Fatalf("after sustained throttling: rate = (%d, %d), want floor (12, 12)", mut, qps)
+	}
+}
+
+func TestRateLimiterWaitIsRaceFree(t *testing.T) {
+	r := newRateLimiter(1000, 1000)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.wait(ctx, 1); err != nil {
+				t.Errorf("wait: %v", err)
+			}
+			r.reportResult(nil)
+		}()
+	}
+	wg.Wait()
+}
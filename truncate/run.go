@@ -27,6 +27,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -35,7 +36,8 @@ import (
 // Otherwise, it deletes from all tables in the database.
 // If excludeTables is not empty, those tables are excluded from the deleted tables.
 // This function internally creates and uses a Cloud Spanner client.
-func Run(ctx context.Context, projectID, instanceID, databaseID string, out io.Writer, whereClause string, targetTables, excludeTables []string) error {
+// Options may be passed to select a non-default Mode, e.g. WithMode(ModePartitionedDML).
+func Run(ctx context.Context, projectID, instanceID, databaseID string, out io.Writer, whereClause string, targetTables, excludeTables []string, opts ...Option) error {
 	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
 
 	client, err := spanner.NewClient(ctx, database)
@@ -47,7 +49,7 @@ func Run(ctx context.Context, projectID, instanceID, databaseID string, out io.W
 		client.Close()
 	}()
 
-	return RunWithClient(ctx, client, out, whereClause, targetTables, excludeTables)
+	return RunWithClient(ctx, client, out, whereClause, targetTables, excludeTables, opts...)
 }
 
 // RunWithClient starts a routine to delete all rows using the given spanner client.
@@ -55,9 +57,24 @@ func Run(ctx context.Context, projectID, instanceID, databaseID string, out io.W
 // Otherwise, it deletes from all tables in the database.
 // If excludeTables is not empty, those tables are excluded from the deleted tables.
 // This function uses an externally passed Cloud Spanner client.
-func RunWithClient(ctx context.Context, client *spanner.Client, out io.Writer, whereClause string, targetTables, excludeTables []string) error {
-	log.SetOutput(out)
-	log.Printf("Fetching table schema from %s\n", client.DatabaseName())
+//
+// By default tables are deleted with read-write-transaction mutations. Pass
+// WithMode(ModePartitionedDML) to delete with server-side partitioned DML
+// instead; tables that are interleaved in a parent without ON DELETE CASCADE
+// are not eligible for partitioned DML and are deleted with mutations regardless.
+func RunWithClient(ctx context.Context, client *spanner.Client, out io.Writer, whereClause string, targetTables, excludeTables []string, opts ...Option) error {
+	o := newOptions(opts)
+	if o.dryRun {
+		return RunPlan(ctx, client, out, whereClause, targetTables, excludeTables, o.planFormat, opts...)
+	}
+	if o.logger == nil {
+		logDest := out
+		if o.stderr != nil {
+			logDest = o.stderr
+		}
+		log.SetOutput(logDest)
+	}
+	logf(o, "Fetching table schema from %s\n", client.DatabaseName())
 	schemas, err := fetchTableSchemas(ctx, client)
 	if err != nil {
 		return fmt.Errorf("failed to fetch table schema: %v", err)
@@ -77,8 +94,13 @@ func RunWithClient(ctx context.Context, client *spanner.Client, out io.Writer, w
 	if err != nil {
 		return fmt.Errorf("failed to coordinate: %v", err)
 	}
+	if o.limiter != nil {
+		// Hands the limiter to the coordinator so its mutation-based deleters
+		// throttle through it the same way the PDML and incremental backends do.
+		coordinator.setRateLimiter(o.limiter)
+	}
 
-	log.Println("Fetching row counts from spanner...")
+	logf(o, "Fetching row counts from spanner...\n")
 
 	for _, table := range flattenTables(coordinator.tables) {
 		table.deleter.updateRowCount(ctx)
@@ -94,33 +116,98 @@ func RunWithClient(ctx context.Context, client *spanner.Client, out io.Writer, w
 		}
 	}
 
+	pdmlTables, mutationTables := partitionTablesByMode(tables, o.mode)
+	if len(pdmlTables) > 0 {
+		names := make([]string, len(pdmlTables))
+		for i, table := range pdmlTables {
+			names[i] = table.tableName
+		}
+		logf(o, "Tables %v will be deleted with partitioned DML.\n", names)
+
+		// coordinator.start/waitCompleted walk the full table tree it was
+		// built with; skipTables keeps it from also deleting the tables we
+		// are about to hand to the PDML backend below, which would race the
+		// two backends against each other on the same rows.
+		coordinator.skipTables(names)
+	}
+
 	if rowsToDelete > 0 {
-		if confirm(fmt.Sprintf("Rows in these tables matching `%s` will be deleted. Do you want to continue?", whereClause)) {
+		if shouldProceed(o, fmt.Sprintf("Rows in these tables matching `%s` will be deleted. Do you want to continue?", whereClause)) {
+
+			var wg sync.WaitGroup
+			for _, table := range pdmlTables {
+				if table.deleter.totalRows == 0 {
+					continue
+				}
+				wg.Add(1)
+				go func(d *pdmlDeleter) {
+					defer wg.Done()
+					var spinner *mpb.Bar
+					if o.progressFormat == ProgressFormatBars {
+						spinner = p.AddSpinner(1, mpb.PrependDecorators(
+							decor.Name(d.tableName, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+						))
+					}
+					if err := d.run(ctx); err != nil {
+						logf(o, "%v\n", err)
+						return
+					}
+					if spinner != nil {
+						spinner.SetCurrent(1)
+					}
+					logf(o, "%s rows deleted from %s (lower bound)\n", formatNumber(d.affectedRows), d.tableName)
+				}(newPDMLDeleter(client, table.tableName, whereClause, o.limiter))
+			}
 
 			coordinator.start(ctx)
 
-			for _, table := range tables {
-				if table.deleter.totalRows > 0 {
-					bar := p.AddBar(int64(table.deleter.totalRows),
+			for _, tbl := range mutationTables {
+				if tbl.deleter.totalRows == 0 {
+					continue
+				}
+				switch o.progressFormat {
+				case ProgressFormatJSONLines:
+					// watch runs until it has emitted a "completed" event for
+					// this table; tracking it in wg (already used for the
+					// PDML goroutines above) keeps RunWithClient from
+					// returning, and out from being considered safe to reuse
+					// or close, while a watcher is still writing to it.
+					reporter := newJSONLinesReporter(out)
+					wg.Add(1)
+					go func(t *table) {
+						defer wg.Done()
+						reporter.watch(t, time.Now)
+					}(tbl)
+				case ProgressFormatNone:
+					// no progress reporting
+				default:
+					appendDecorators := []decor.Decorator{
+						decor.OnComplete(
+							decor.Percentage(decor.WC{W: 5}), "done",
+						),
+					}
+					if o.limiter != nil {
+						appendDecorators = append(appendDecorators, decor.Any(func(decor.Statistics) string {
+							mutPerSec, qps := o.limiter.currentRate()
+							return fmt.Sprintf(" (%d mut/s, %d qps)", mutPerSec, qps)
+						}))
+					}
+					bar := p.AddBar(int64(tbl.deleter.totalRows),
 						mpb.PrependDecorators(
-							decor.Name(table.tableName, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+							decor.Name(tbl.tableName, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
 							decor.CountersNoUnit("(%d / %d)", decor.WCSyncWidth),
 						),
-						mpb.AppendDecorators(
-							decor.OnComplete(
-								decor.Percentage(decor.WC{W: 5}), "done",
-							),
-						),
+						mpb.AppendDecorators(appendDecorators...),
 					)
 					go func() {
 						for {
-							switch table.deleter.status {
+							switch tbl.deleter.status {
 							case statusCompleted:
-								bar.SetCurrent(int64(table.deleter.totalRows))
+								bar.SetCurrent(int64(tbl.deleter.totalRows))
 							case statusAnalyzing:
 								// nop
 							default:
-								deletedRows := table.deleter.totalRows - table.deleter.remainedRows
+								deletedRows := tbl.deleter.totalRows - tbl.deleter.remainedRows
 								bar.SetCurrent(int64(deletedRows))
 							}
 
@@ -134,13 +221,124 @@ func RunWithClient(ctx context.Context, client *spanner.Client, out io.Writer, w
 				return fmt.Errorf("failed to delete: %v", err)
 			}
 
-			p.Wait()
+			wg.Wait()
+			if o.progressFormat == ProgressFormatBars {
+				p.Wait()
+			}
 
-			log.Printf("Done! All rows matching `%s` have been deleted successfully.\n", whereClause)
+			logf(o, "Done! All rows matching `%s` have been deleted successfully.\n", whereClause)
 		}
 	} else {
-		log.Printf("No rows found in these tables matching `%s`.\n", whereClause)
+		logf(o, "No rows found in these tables matching `%s`.\n", whereClause)
+	}
+	return nil
+}
+
+// RunIncremental deletes only the rows that changed since sinceTimestamp, as
+// observed on the named Cloud Spanner change stream, instead of scanning the
+// target tables in full. This is dramatically cheaper than Run/RunWithClient
+// on large tables when only a recent slice of rows needs to be truncated; on
+// the CLI it is the backend for --change-stream/--since.
+//
+// Progress is checkpointed per change stream, under WithCheckpointDir (which
+// defaults to os.TempDir() - pass a durable directory if the process runs
+// somewhere that clears it, e.g. a Kubernetes Job), so that re-running after
+// a failure resumes from the last processed commit timestamp rather than
+// rereading sinceTimestamp onward.
+//
+// WithRateLimit is honored here: each table's deleteKeys call is gated on
+// the shared limiter, same as the partitioned DML backend. WithLogger,
+// WithStderr and WithNonInteractive are honored the same way they are by
+// RunWithClient, so a caller that needs RunIncremental to run unattended in
+// a CI job or a Kubernetes Job gets the same guarantee it gets there: it
+// never blocks on os.Stdin. WithDryRun and WithProgressFormat have no
+// effect here - RunIncremental already prints a one-line summary per table
+// instead of rendering bar/JSON-lines progress, and has no separate plan
+// mode to compute.
+func RunIncremental(ctx context.Context, client *spanner.Client, streamName string, sinceTimestamp time.Time, out io.Writer, whereClause string, targetTables, excludeTables []string, opts ...Option) error {
+	o := newOptions(opts)
+	if o.logger == nil {
+		logDest := out
+		if o.stderr != nil {
+			logDest = o.stderr
+		}
+		log.SetOutput(logDest)
+	}
+	logf(o, "Fetching table schema from %s\n", client.DatabaseName())
+	schemas, err := fetchTableSchemas(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch table schema: %v", err)
+	}
+
+	schemas, err = filterTableSchemas(schemas, targetTables, excludeTables)
+	if err != nil {
+		return fmt.Errorf("failed to filter table schema: %v", err)
+	}
+
+	indexes, err := fetchIndexSchemas(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch index schema: %v", err)
+	}
+
+	coordinator, err := newCoordinator(schemas, indexes, client, whereClause)
+	if err != nil {
+		return fmt.Errorf("failed to coordinate: %v", err)
+	}
+
+	tables := flattenTables(coordinator.tables)
+	primaryKeys := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		primaryKeys[table.tableName] = table.primaryKeyColumns
+	}
+
+	checkpointDir := o.checkpointDir
+	if checkpointDir == "" {
+		checkpointDir = os.TempDir()
+	}
+	logf(o, "Reading change stream %s since %s\n", streamName, sinceTimestamp.Format(time.RFC3339))
+	reader := newChangeStreamReader(client, streamName, newFileCheckpointStore(checkpointDir))
+	keysByTable, err := reader.read(ctx, sinceTimestamp, primaryKeys)
+	if err != nil {
+		return fmt.Errorf("failed to read change stream: %v", err)
+	}
+
+	rowsToDelete := 0
+	for _, table := range tables {
+		if keys := keysByTable[table.tableName]; len(keys) > 0 {
+			rowsToDelete += len(keys)
+			print(fmt.Sprintf("%s rows from %s\n", formatNumber(int64(len(keys))), table.tableName))
+		}
 	}
+
+	if rowsToDelete == 0 {
+		logf(o, "No changed rows found on %s since %s.\n", streamName, sinceTimestamp.Format(time.RFC3339))
+		return nil
+	}
+
+	if !shouldProceed(o, fmt.Sprintf("Rows changed on `%s` matching `%s` will be deleted. Do you want to continue?", streamName, whereClause)) {
+		return nil
+	}
+
+	for _, table := range tables {
+		keys := keysByTable[table.tableName]
+		if len(keys) == 0 {
+			continue
+		}
+		if o.limiter != nil {
+			if err := o.limiter.wait(ctx, len(keys)); err != nil {
+				return fmt.Errorf("failed to wait for rate limiter on %s: %v", table.tableName, err)
+			}
+		}
+		err := table.deleter.deleteKeys(ctx, keys)
+		if o.limiter != nil {
+			o.limiter.reportResult(err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete changed rows from %s: %v", table.tableName, err)
+		}
+	}
+
+	logf(o, "Done! All rows that changed on `%s` since %s have been deleted successfully.\n", streamName, sinceTimestamp.Format(time.RFC3339))
 	return nil
 }
 